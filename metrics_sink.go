@@ -0,0 +1,59 @@
+package flashback
+
+import (
+	"fmt"
+	"time"
+)
+
+// MetricsSink lets flashback export live progress to an external system
+// while a replay is running, instead of only being readable via
+// StatsAnalyzer.GetStatus() from inside the process. Implementations must
+// be safe for concurrent use: ObserveLatency and IncOps are called from
+// the analyzer's drain goroutine for every op.
+type MetricsSink interface {
+	// ObserveLatency records a single op's latency.
+	ObserveLatency(opType OpType, latency time.Duration)
+	// IncOps increments the op count for opType by one.
+	IncOps(opType OpType)
+	// Flush pushes any buffered data to the backend. It is called
+	// periodically by the analyzer's drain loop (see sinkFlushInterval)
+	// and once more after drain exits, so the backend never goes stale
+	// for longer than that interval even if Close is never called.
+	Flush() error
+}
+
+// MetricsSinkFactory builds a MetricsSink from an address/configuration
+// string (e.g. a listen address, or a host:port to dial).
+type MetricsSinkFactory func(addr string) (MetricsSink, error)
+
+var metricsSinkFactories = map[string]MetricsSinkFactory{}
+
+// RegisterMetricsSink makes a MetricsSink implementation available under
+// name, so it can be selected with NewMetricsSink (and, in the flashback
+// binary, with the --metrics-sink flag). Callers can register their own
+// sinks from an init() without needing to fork flashback.
+func RegisterMetricsSink(name string, factory MetricsSinkFactory) {
+	metricsSinkFactories[name] = factory
+}
+
+// NewMetricsSink builds the MetricsSink registered under name, passing it
+// addr. It returns an error if no sink is registered under that name.
+func NewMetricsSink(name, addr string) (MetricsSink, error) {
+	factory, ok := metricsSinkFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("flashback: no MetricsSink registered under name %q", name)
+	}
+	return factory(addr)
+}
+
+func init() {
+	RegisterMetricsSink("prometheus", func(addr string) (MetricsSink, error) {
+		return NewPrometheusSink(addr)
+	})
+	RegisterMetricsSink("graphite", func(addr string) (MetricsSink, error) {
+		return NewGraphiteSink(addr)
+	})
+	RegisterMetricsSink("statsd", func(addr string) (MetricsSink, error) {
+		return NewStatsDSink(addr)
+	})
+}
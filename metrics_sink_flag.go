@@ -0,0 +1,60 @@
+package flashback
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetricsSinkFlag is a flag.Value that parses a "name=addr" string (e.g.
+// "statsd=localhost:8125") into a MetricsSink built via NewMetricsSink, so
+// a binary embedding flashback can expose --metrics-sink without each one
+// having to duplicate the registry lookup and error handling:
+//
+//	var sinkFlag flashback.MetricsSinkFlag
+//	flag.Var(&sinkFlag, "metrics-sink", "name=addr of a metrics sink to export live progress to")
+//	flag.Parse()
+//	analyzer := flashback.NewStatsAnalyzer(..., sinkFlag.Sink()...)
+//
+// flashback does not ship a main package itself, so nothing in this repo
+// calls flag.Parse(); this only gives an embedding binary a ready-made
+// flag.Value to wire up.
+type MetricsSinkFlag struct {
+	name string
+	addr string
+	sink MetricsSink
+}
+
+// String returns the flag's current "name=addr" value, or "" if unset.
+func (f *MetricsSinkFlag) String() string {
+	if f.name == "" {
+		return ""
+	}
+	return f.name + "=" + f.addr
+}
+
+// Set parses "name=addr", builds the sink via NewMetricsSink, and reports
+// any error from either the parse or the build.
+func (f *MetricsSinkFlag) Set(value string) error {
+	name, addr, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("flashback: --metrics-sink value %q must be of the form name=addr", value)
+	}
+	sink, err := NewMetricsSink(name, addr)
+	if err != nil {
+		return err
+	}
+	f.name = name
+	f.addr = addr
+	f.sink = sink
+	return nil
+}
+
+// Sink returns the configured sink as a single-element []MetricsSink,
+// ready to pass as NewStatsAnalyzer's variadic sinks argument, or nil if
+// the flag was never set.
+func (f *MetricsSinkFlag) Sink() []MetricsSink {
+	if f.sink == nil {
+		return nil
+	}
+	return []MetricsSink{f.sink}
+}
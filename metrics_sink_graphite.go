@@ -0,0 +1,55 @@
+package flashback
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// GraphiteSink pushes op counts and latency observations to a Graphite
+// carbon receiver over TCP using the plaintext protocol:
+// "<metric path> <value> <unix timestamp>\n".
+type GraphiteSink struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	writer *bufio.Writer
+
+	counts map[OpType]uint64
+}
+
+// NewGraphiteSink dials addr (a carbon "host:port") and returns a
+// MetricsSink that writes to it.
+func NewGraphiteSink(addr string) (*GraphiteSink, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("flashback: graphite sink: %w", err)
+	}
+	return &GraphiteSink{
+		conn:   conn,
+		writer: bufio.NewWriter(conn),
+		counts: make(map[OpType]uint64),
+	}, nil
+}
+
+func (g *GraphiteSink) ObserveLatency(opType OpType, latency time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	millis := float64(latency) / float64(time.Millisecond)
+	fmt.Fprintf(g.writer, "flashback.latency_ms.%v %f %d\n", opType, millis, time.Now().Unix())
+}
+
+func (g *GraphiteSink) IncOps(opType OpType) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counts[opType]++
+	fmt.Fprintf(g.writer, "flashback.ops_total.%v %d %d\n", opType, g.counts[opType], time.Now().Unix())
+}
+
+// Flush flushes any buffered lines to the underlying TCP connection.
+func (g *GraphiteSink) Flush() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.writer.Flush()
+}
@@ -0,0 +1,111 @@
+package flashback
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PrometheusSink exposes op counts and latency histograms on an HTTP
+// /metrics endpoint in the Prometheus text exposition format. It has no
+// dependency on the prometheus client library so flashback can keep a
+// minimal dependency footprint.
+type PrometheusSink struct {
+	mu         sync.Mutex
+	counts     map[OpType]uint64
+	histograms map[OpType]*latencyHistogram
+
+	server *http.Server
+}
+
+// prometheusBucketsMillis are the histogram bucket upper bounds, in
+// milliseconds, that latency observations are sorted into.
+var prometheusBucketsMillis = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type latencyHistogram struct {
+	buckets []uint64 // cumulative counts, one per prometheusBucketsMillis entry
+	sum     float64
+	count   uint64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]uint64, len(prometheusBucketsMillis))}
+}
+
+func (h *latencyHistogram) observe(millis float64) {
+	h.sum += millis
+	h.count++
+	i := sort.SearchFloat64s(prometheusBucketsMillis, millis)
+	for ; i < len(h.buckets); i++ {
+		h.buckets[i]++
+	}
+}
+
+// NewPrometheusSink starts an HTTP server on addr (e.g. ":9090") serving
+// /metrics, and returns a MetricsSink that feeds it.
+func NewPrometheusSink(addr string) (*PrometheusSink, error) {
+	sink := &PrometheusSink{
+		counts:     make(map[OpType]uint64),
+		histograms: make(map[OpType]*latencyHistogram),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", sink.handleMetrics)
+	sink.server = &http.Server{Addr: addr, Handler: mux}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("flashback: prometheus sink: %w", err)
+	}
+	go sink.server.Serve(ln)
+
+	return sink, nil
+}
+
+func (p *PrometheusSink) ObserveLatency(opType OpType, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hist, ok := p.histograms[opType]
+	if !ok {
+		hist = newLatencyHistogram()
+		p.histograms[opType] = hist
+	}
+	hist.observe(float64(latency) / float64(time.Millisecond))
+}
+
+func (p *PrometheusSink) IncOps(opType OpType) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[opType]++
+}
+
+// Flush is a no-op: /metrics always serves the current in-memory state.
+func (p *PrometheusSink) Flush() error {
+	return nil
+}
+
+func (p *PrometheusSink) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP flashback_ops_total Total ops executed per op type.")
+	fmt.Fprintln(w, "# TYPE flashback_ops_total counter")
+	for opType, count := range p.counts {
+		fmt.Fprintf(w, "flashback_ops_total{op_type=%q} %d\n", fmt.Sprint(opType), count)
+	}
+
+	fmt.Fprintln(w, "# HELP flashback_latency_milliseconds Op latency in milliseconds.")
+	fmt.Fprintln(w, "# TYPE flashback_latency_milliseconds histogram")
+	for opType, hist := range p.histograms {
+		label := fmt.Sprint(opType)
+		for i, bound := range prometheusBucketsMillis {
+			fmt.Fprintf(w, "flashback_latency_milliseconds_bucket{op_type=%q,le=%q} %d\n", label, fmt.Sprint(bound), hist.buckets[i])
+		}
+		fmt.Fprintf(w, "flashback_latency_milliseconds_bucket{op_type=%q,le=\"+Inf\"} %d\n", label, hist.count)
+		fmt.Fprintf(w, "flashback_latency_milliseconds_sum{op_type=%q} %f\n", label, hist.sum)
+		fmt.Fprintf(w, "flashback_latency_milliseconds_count{op_type=%q} %d\n", label, hist.count)
+	}
+}
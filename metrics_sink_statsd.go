@@ -0,0 +1,49 @@
+package flashback
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// StatsDSink sends op counts and latency timers to a StatsD daemon over
+// UDP, using the conventional "<bucket>:<value>|<type>" line format.
+type StatsDSink struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewStatsDSink dials addr (a StatsD "host:port") over UDP and returns a
+// MetricsSink that writes to it.
+func NewStatsDSink(addr string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("flashback: statsd sink: %w", err)
+	}
+	return &StatsDSink{conn: conn}, nil
+}
+
+func (s *StatsDSink) ObserveLatency(opType OpType, latency time.Duration) {
+	millis := float64(latency) / float64(time.Millisecond)
+	s.send(fmt.Sprintf("flashback.latency_ms.%v:%f|ms", opType, millis))
+}
+
+func (s *StatsDSink) IncOps(opType OpType) {
+	s.send(fmt.Sprintf("flashback.ops_total.%v:1|c", opType))
+}
+
+// Flush is a no-op: each metric is sent as its own UDP datagram as soon as
+// it's observed.
+func (s *StatsDSink) Flush() error {
+	return nil
+}
+
+func (s *StatsDSink) send(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Best-effort: StatsD over UDP is fire-and-forget, so a dropped
+	// datagram or a transient write error isn't worth surfacing to the
+	// hot path that calls ObserveLatency/IncOps for every op.
+	s.conn.Write([]byte(line))
+}
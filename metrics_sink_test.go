@@ -0,0 +1,168 @@
+package flashback
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsDSinkLineFormat(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewStatsDSink: %v", err)
+	}
+
+	sink.ObserveLatency(AllOpTypes[0], 5*time.Millisecond)
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	line := string(buf[:n])
+	wantPrefix := "flashback.latency_ms." + opTypeString(AllOpTypes[0]) + ":"
+	if !strings.HasPrefix(line, wantPrefix) || !strings.HasSuffix(line, "|ms") {
+		t.Errorf("ObserveLatency line = %q, want prefix %q and suffix %q", line, wantPrefix, "|ms")
+	}
+
+	sink.IncOps(AllOpTypes[0])
+	n, _, err = conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	line = string(buf[:n])
+	want := "flashback.ops_total." + opTypeString(AllOpTypes[0]) + ":1|c"
+	if line != want {
+		t.Errorf("IncOps line = %q, want %q", line, want)
+	}
+}
+
+func TestGraphiteSinkFlushWritesBufferedLines(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	sink, err := NewGraphiteSink(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("NewGraphiteSink: %v", err)
+	}
+	conn := <-accepted
+	defer conn.Close()
+
+	sink.IncOps(AllOpTypes[0])
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != "flashback.ops_total."+opTypeString(AllOpTypes[0]) || fields[1] != "1" {
+		t.Errorf("IncOps line = %q, want \"flashback.ops_total.%s 1 <unix ts>\"", line, opTypeString(AllOpTypes[0]))
+	}
+}
+
+func TestPrometheusSinkHandleMetrics(t *testing.T) {
+	sink := &PrometheusSink{
+		counts:     make(map[OpType]uint64),
+		histograms: make(map[OpType]*latencyHistogram),
+	}
+	sink.IncOps(AllOpTypes[0])
+	sink.IncOps(AllOpTypes[0])
+	sink.ObserveLatency(AllOpTypes[0], 2*time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	sink.handleMetrics(rec, req)
+	body := rec.Body.String()
+
+	label := opTypeString(AllOpTypes[0])
+	if !strings.Contains(body, `flashback_ops_total{op_type="`+label+`"} 2`) {
+		t.Errorf("handleMetrics body missing ops_total line for %s:\n%s", label, body)
+	}
+	// 2ms falls in the (1,5] gap: above the 1ms bound, at or below the 5ms
+	// bound, so it's counted starting from the "5" bucket upward but not
+	// in "1".
+	if !strings.Contains(body, `flashback_latency_milliseconds_bucket{op_type="`+label+`",le="5"} 1`) {
+		t.Errorf("handleMetrics body missing histogram bucket for %s:\n%s", label, body)
+	}
+	if !strings.Contains(body, `flashback_latency_milliseconds_bucket{op_type="`+label+`",le="1"} 0`) {
+		t.Errorf("2ms observation leaked into the 1ms bucket:\n%s", body)
+	}
+	if !strings.Contains(body, `flashback_latency_milliseconds_count{op_type="`+label+`"} 1`) {
+		t.Errorf("handleMetrics body missing histogram count for %s:\n%s", label, body)
+	}
+}
+
+func TestMetricsSinkRegistry(t *testing.T) {
+	if _, err := NewMetricsSink("no-such-sink", "addr"); err == nil {
+		t.Error("expected an error for an unregistered sink name, got nil")
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewMetricsSink("statsd", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewMetricsSink(\"statsd\", ...): %v", err)
+	}
+	if _, ok := sink.(*StatsDSink); !ok {
+		t.Errorf("NewMetricsSink(\"statsd\", ...) returned %T, want *StatsDSink", sink)
+	}
+}
+
+func TestMetricsSinkFlag(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	var f MetricsSinkFlag
+	value := "statsd=" + conn.LocalAddr().String()
+	if err := f.Set(value); err != nil {
+		t.Fatalf("Set(%q): %v", value, err)
+	}
+	if got := f.String(); got != value {
+		t.Errorf("String() = %q, want %q", got, value)
+	}
+	if sinks := f.Sink(); len(sinks) != 1 {
+		t.Errorf("Sink() = %v, want a single-element slice", sinks)
+	}
+
+	if err := f.Set("missing-equals-sign"); err == nil {
+		t.Error("expected an error for a value without '=', got nil")
+	}
+}
+
+// opTypeString mirrors the %v formatting the sinks already use to turn an
+// OpType into a metric path/label, so tests don't hardcode its string form.
+func opTypeString(opType OpType) string {
+	return fmt.Sprint(opType)
+}
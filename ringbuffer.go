@@ -0,0 +1,77 @@
+package flashback
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// recordedOp is one observation pushed through a latencyRingBuffer: the
+// same (OpType, latency) pair Record receives, plus whether the op
+// errored, so drain can track per-OpType error rates alongside latency
+// percentiles.
+type recordedOp struct {
+	opType  OpType
+	latency time.Duration
+	errored bool
+}
+
+// latencyRingBuffer is a single-producer/single-consumer ring buffer of
+// recordedOp values, sized to a power of two so index wrapping is a cheap
+// bitmask instead of a modulo. The producer (one worker goroutine) calls
+// push; the consumer (the analyzer's drain goroutine) calls pop. head and
+// tail are each written by exactly one side and only read by the other,
+// so a plain atomic load/store publishes them safely without a lock. It
+// is NOT safe for more than one goroutine to call push concurrently on
+// the same buffer: StatsAnalyzer.Record maps each workerID to exactly one
+// shard, and its callers must use each workerID from only one goroutine.
+type latencyRingBuffer struct {
+	buf  []recordedOp
+	mask uint64
+	head uint64 // next slot to read; owned by the consumer
+	tail uint64 // next slot to write; owned by the producer
+}
+
+// newLatencyRingBuffer returns an empty ring buffer with capacity rounded
+// up to the next power of two (minimum 2).
+func newLatencyRingBuffer(size int) *latencyRingBuffer {
+	capacity := 2
+	for capacity < size {
+		capacity *= 2
+	}
+	return &latencyRingBuffer{
+		buf:  make([]recordedOp, capacity),
+		mask: uint64(capacity - 1),
+	}
+}
+
+// push appends l to the buffer and reports true, or reports false without
+// blocking if the buffer is currently full.
+func (r *latencyRingBuffer) push(l recordedOp) bool {
+	head := atomic.LoadUint64(&r.head)
+	tail := r.tail
+	if tail-head == uint64(len(r.buf)) {
+		return false
+	}
+	r.buf[tail&r.mask] = l
+	atomic.StoreUint64(&r.tail, tail+1)
+	return true
+}
+
+// empty reports whether the consumer has caught up with every value the
+// producer has pushed so far.
+func (r *latencyRingBuffer) empty() bool {
+	return atomic.LoadUint64(&r.head) == atomic.LoadUint64(&r.tail)
+}
+
+// pop removes and returns the oldest value in the buffer, reporting false
+// if the buffer is currently empty.
+func (r *latencyRingBuffer) pop() (recordedOp, bool) {
+	head := r.head
+	tail := atomic.LoadUint64(&r.tail)
+	if head == tail {
+		return recordedOp{}, false
+	}
+	l := r.buf[head&r.mask]
+	atomic.StoreUint64(&r.head, head+1)
+	return l, true
+}
@@ -0,0 +1,24 @@
+package flashback
+
+import "time"
+
+// SLO is a per-OpType service-level objective checked on every GetStatus()
+// call. A violation is recorded whenever the op type's since-last window
+// exceeds MaxP99Latency, MaxErrorRate, or both; either bound is ignored
+// when left at its zero value.
+type SLO struct {
+	MaxP99Latency time.Duration
+	// MaxErrorRate, if nonzero, bounds the fraction of ops in the
+	// since-last window that were recorded as errored (0.001 == 0.1%).
+	MaxErrorRate float64
+}
+
+func (slo SLO) violated(sinceLastLatencies []int64, sinceLastErrorRate float64) bool {
+	if slo.MaxP99Latency != 0 && time.Duration(sinceLastLatencies[P99]) > slo.MaxP99Latency {
+		return true
+	}
+	if slo.MaxErrorRate != 0 && sinceLastErrorRate > slo.MaxErrorRate {
+		return true
+	}
+	return false
+}
@@ -1,8 +1,10 @@
 package flashback
 
 import (
-	"sort"
+	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,35 +25,82 @@ const (
 	P100 = iota
 )
 
+// defaultShardSize is the capacity (rounded up to a power of two) of each
+// per-worker latencyRingBuffer when shardSize <= 0 is passed to
+// NewStatsAnalyzer.
+const defaultShardSize = 1024
+
+// sinkFlushInterval is how often drain flushes every configured
+// MetricsSink. Some sinks (e.g. GraphiteSink) only push buffered writes to
+// the wire on Flush, so without a periodic flush a long-running replay
+// would leave an external dashboard stale until the very end.
+const sinkFlushInterval = 1 * time.Second
+
+// NewStatsAnalyzer creates a StatsAnalyzer that tracks latency percentiles
+// per OpType with a t-digest, so memory use stays bounded no matter how
+// long the replay runs. Workers report latencies through Record, which
+// writes to one of numShards single-producer/single-consumer ring
+// buffers (shardSize <= 0 falls back to defaultShardSize); callers
+// typically pass one shard per worker goroutine so Record never contends.
+// compression controls the accuracy/centroid-count trade-off of the
+// underlying digests (see TDigest); a compression <= 0 falls back to
+// defaultCompression. slos is consulted on every GetStatus() call to
+// populate ExecutionStatus.SLOViolations; pass nil if the caller doesn't
+// want SLO tracking. Any sinks passed in are fed every observed op
+// alongside the in-memory digests, so progress can be watched live from
+// outside the process (see MetricsSink).
 func NewStatsAnalyzer(
 	statsCollectors []*StatsCollector,
 	opsExecuted *int64,
-	latencyChan chan Latency,
-	latenciesSize int) *StatsAnalyzer {
-	latencies := map[OpType][]int64{}
-	lastEndPos := map[OpType]int{}
+	numShards int,
+	shardSize int,
+	compression int,
+	slos map[OpType]SLO,
+	sinks ...MetricsSink) *StatsAnalyzer {
+	if numShards <= 0 {
+		numShards = 1
+	}
+	if shardSize <= 0 {
+		shardSize = defaultShardSize
+	}
+
+	digests := map[OpType]*TDigest{}
+	sinceLastDigests := map[OpType]*TDigest{}
+	sinceLastTotal := make(map[OpType]int64)
+	sinceLastErrored := make(map[OpType]int64)
 	counts := make(map[OpType]int64)
 	countsLast := make(map[OpType]int64)
 
 	for _, opType := range AllOpTypes {
-		latencies[opType] = make([]int64, 0, latenciesSize)
-		lastEndPos[opType] = 0
+		digests[opType] = NewTDigest(float64(compression))
+		sinceLastDigests[opType] = NewTDigest(float64(compression))
+	}
+
+	shards := make([]*latencyRingBuffer, numShards)
+	for i := range shards {
+		shards[i] = newLatencyRingBuffer(shardSize)
 	}
 
 	sa := &StatsAnalyzer{
-		statsCollectors: statsCollectors,
-		opsExecuted:     opsExecuted,
-		opsExecutedLast: 0,
-		latencyChan:     latencyChan,
-		latencies:       latencies,
-		epoch:           time.Now(),
-		timeLast:        time.Now(),
-		lastEndPos:      lastEndPos,
-		counts:          counts,
-		countsLast:      countsLast,
-		finished:        make(chan struct{}),
-	}
-	go sa.consumeLatencyChan()
+		statsCollectors:  statsCollectors,
+		opsExecuted:      opsExecuted,
+		opsExecutedLast:  0,
+		shards:           shards,
+		digests:          digests,
+		sinceLastDigests: sinceLastDigests,
+		sinceLastTotal:   sinceLastTotal,
+		sinceLastErrored: sinceLastErrored,
+		epoch:            time.Now(),
+		timeLast:         time.Now(),
+		counts:           counts,
+		countsLast:       countsLast,
+		slos:             slos,
+		sloEverViolated:  make(map[OpType]bool),
+		sinks:            sinks,
+		resetRequest:     make(chan chan struct{}),
+		finished:         make(chan struct{}),
+	}
+	go sa.drain()
 	return sa
 }
 
@@ -70,47 +119,224 @@ type ExecutionStatus struct {
 	CountsLast         map[OpType]int64
 	TypeOpsSec         map[OpType]float64
 	TypeOpsSecLast     map[OpType]float64
+	// SLOViolations reports, for each OpType with an SLO configured,
+	// whether its since-last window violated that SLO this call.
+	SLOViolations map[OpType]bool
+	// SLOViolationCount is the running total of per-OpType SLO violations
+	// observed across the lifetime of this analyzer.
+	SLOViolationCount int64
+	// SLOEverViolated reports, for each OpType with an SLO configured,
+	// whether it has violated that SLO on this or any earlier GetStatus()
+	// call during the lifetime of this analyzer.
+	SLOEverViolated map[OpType]bool
 }
 
 type StatsAnalyzer struct {
+	// mu serializes GetStatus() against itself; it is never taken on the
+	// producer (Record/drain) path, which relies on seq instead.
 	mu              sync.Mutex
 	statsCollectors []*StatsCollector
 	// store total ops executed during the run
 	opsExecuted *int64
 	// store ops executed at the time of the last GetStatus() call
 	opsExecutedLast int64
-	latencyChan     chan Latency
-	latencies       map[OpType][]int64
+	// shards holds one single-producer/single-consumer ring buffer per
+	// worker; Record(workerID, ...) writes to shards[workerID] and only
+	// the drain goroutine ever reads from them.
+	shards []*latencyRingBuffer
+	// seq is a seqlock guarding digests/sinceLastDigests: drain bumps it
+	// odd before mutating them and even after, so GetStatus can take a
+	// lock-free, retry-on-concurrent-write snapshot.
+	seq uint64
+	// digests holds the all-time t-digest per OpType.
+	digests map[OpType]*TDigest
+	// sinceLastDigests holds the t-digest accumulated since the last
+	// GetStatus() call; drain resets it once GetStatus() has read it.
+	sinceLastDigests map[OpType]*TDigest
+	// sinceLastTotal and sinceLastErrored count all ops and errored ops,
+	// per OpType, since the last GetStatus() call; drain resets both
+	// alongside sinceLastDigests so SLO.MaxErrorRate is checked against
+	// the same window as SLO.MaxP99Latency.
+	sinceLastTotal   map[OpType]int64
+	sinceLastErrored map[OpType]int64
 	// Store the start of the run
 	epoch time.Time
 	// Store the time of the last GetStatus() call
 	timeLast   time.Time
-	lastEndPos map[OpType]int
 	counts     map[OpType]int64
 	countsLast map[OpType]int64
-	finished   chan struct{}
+	// slos holds the configured SLO, if any, per OpType.
+	slos map[OpType]SLO
+	// sloViolationCount is the running total of SLOViolations reported
+	// across every GetStatus() call.
+	sloViolationCount int64
+	// sloEverViolated records every OpType that has violated its SLO on
+	// this or any earlier GetStatus() call, so StreamStatus's end-of-run
+	// summary can report the full set rather than just the last window.
+	sloEverViolated map[OpType]bool
+	// sinks are fed every op Record sees, for live export.
+	sinks []MetricsSink
+	// resetRequest asks drain to start a fresh sinceLastDigests window.
+	// GetStatus sends an ack channel once it has read the current window,
+	// and blocks on it until drain has actually performed the reset, so
+	// that any op Recorded after GetStatus returns is guaranteed to land
+	// in the new window rather than racing a reset that hasn't happened
+	// yet.
+	resetRequest chan chan struct{}
+	// stopped is set once Close has been called, telling drain to exit
+	// after it has drained everything already pushed to the shards.
+	stopped  int32
+	finished chan struct{}
+}
+
+// Record reports a single op's latency and whether it errored, attributing
+// it to the shard for workerID. It never blocks on a lock: if that
+// worker's ring buffer is momentarily full because drain hasn't caught up,
+// it busy-waits with runtime.Gosched() rather than contending with other
+// workers. Sinks are notified later, from drain, so Record itself never
+// touches a sink.
+//
+// Each shard is a single-producer ring buffer, so every workerID must map
+// to exactly one shard and only ever be used by one goroutine at a time;
+// sizing numShards to the number of concurrent callers and giving each
+// its own stable workerID (e.g. 0..numWorkers-1) satisfies that. Record
+// panics if workerID is out of range rather than silently wrapping it
+// onto another worker's shard, which would corrupt that shard under
+// concurrent use.
+func (s *StatsAnalyzer) Record(workerID int, op OpType, latency time.Duration, errored bool) {
+	if workerID < 0 || workerID >= len(s.shards) {
+		panic(fmt.Sprintf(
+			"flashback: Record called with workerID %d but only %d shards exist; "+
+				"size numShards to the number of concurrent workers and give each a stable, distinct workerID",
+			workerID, len(s.shards)))
+	}
+	shard := s.shards[workerID]
+	l := recordedOp{opType: op, latency: latency, errored: errored}
+	for !shard.push(l) {
+		runtime.Gosched()
+	}
 }
 
-func (s *StatsAnalyzer) consumeLatencyChan() {
+// Close signals that no further Records will be made. It does not block;
+// wait on the channel returned by Finished to know when drain has
+// consumed everything already recorded.
+func (s *StatsAnalyzer) Close() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
+// Finished returns a channel that's closed once drain has consumed every
+// shard after Close was called.
+func (s *StatsAnalyzer) Finished() <-chan struct{} {
+	return s.finished
+}
+
+// drain is the sole consumer of every shard and the sole writer of
+// digests/sinceLastDigests, so it never needs to contend with Record for
+// a lock; it only needs to publish its writes to GetStatus via seq.
+func (s *StatsAnalyzer) drain() {
+	lastFlush := time.Now()
 	defer func() {
+		for _, sink := range s.sinks {
+			sink.Flush()
+		}
 		close(s.finished)
 	}()
 	for {
-		op, ok := <-s.latencyChan
-		if !ok {
-			break
+		progressed := false
+		for _, shard := range s.shards {
+			for {
+				l, ok := shard.pop()
+				if !ok {
+					break
+				}
+				progressed = true
+				s.insert(l.opType, l.latency, l.errored)
+			}
+		}
+
+		select {
+		case ack := <-s.resetRequest:
+			s.resetSinceLast()
+			close(ack)
+		default:
+		}
+
+		if len(s.sinks) > 0 && time.Since(lastFlush) >= sinkFlushInterval {
+			for _, sink := range s.sinks {
+				sink.Flush()
+			}
+			lastFlush = time.Now()
+		}
+
+		if !progressed {
+			if atomic.LoadInt32(&s.stopped) == 1 {
+				return
+			}
+			runtime.Gosched()
+		}
+	}
+}
+
+func (s *StatsAnalyzer) insert(op OpType, latency time.Duration, errored bool) {
+	atomic.AddUint64(&s.seq, 1)
+	s.digests[op].Insert(float64(latency))
+	s.sinceLastDigests[op].Insert(float64(latency))
+	s.sinceLastTotal[op]++
+	if errored {
+		s.sinceLastErrored[op]++
+	}
+	atomic.AddUint64(&s.seq, 1)
+
+	// drain is the sole consumer, so sinks only ever see one goroutine
+	// here rather than contending with every worker calling Record.
+	for _, sink := range s.sinks {
+		sink.ObserveLatency(op, latency)
+		sink.IncOps(op)
+	}
+}
+
+func (s *StatsAnalyzer) resetSinceLast() {
+	atomic.AddUint64(&s.seq, 1)
+	for _, opType := range AllOpTypes {
+		s.sinceLastDigests[opType] = NewTDigest(s.digests[opType].compression)
+		s.sinceLastTotal[opType] = 0
+		s.sinceLastErrored[opType] = 0
+	}
+	atomic.AddUint64(&s.seq, 1)
+}
+
+// snapshotLatencies takes a consistent read of digests/sinceLastDigests
+// (and the since-last error-rate counters that back SLO.MaxErrorRate) via
+// the seqlock in s.seq, retrying if drain mutated them mid-read.
+func (s *StatsAnalyzer) snapshotLatencies() (allTime, sinceLast map[OpType][]int64, sinceLastErrorRate map[OpType]float64) {
+	for {
+		seq1 := atomic.LoadUint64(&s.seq)
+		if seq1%2 != 0 {
+			runtime.Gosched()
+			continue
+		}
+
+		allTime = make(map[OpType][]int64, len(AllOpTypes))
+		sinceLast = make(map[OpType][]int64, len(AllOpTypes))
+		sinceLastErrorRate = make(map[OpType]float64, len(AllOpTypes))
+		for _, opType := range AllOpTypes {
+			allTime[opType] = CalculateLatencyStats(s.digests[opType])
+			sinceLast[opType] = CalculateLatencyStats(s.sinceLastDigests[opType])
+			if total := s.sinceLastTotal[opType]; total != 0 {
+				sinceLastErrorRate[opType] = float64(s.sinceLastErrored[opType]) / float64(total)
+			}
+		}
+
+		seq2 := atomic.LoadUint64(&s.seq)
+		if seq1 == seq2 {
+			return allTime, sinceLast, sinceLastErrorRate
 		}
-		s.mu.Lock()
-		s.latencies[op.OpType] = append(
-			s.latencies[op.OpType], int64(op.Latency),
-		)
-		s.mu.Unlock()
 	}
 }
 
 func (self *StatsAnalyzer) GetStatus() *ExecutionStatus {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	// Basics
 	duration := time.Now().Sub(self.epoch)
 	opsPerSec := 0.0
@@ -126,23 +352,29 @@ func (self *StatsAnalyzer) GetStatus() *ExecutionStatus {
 
 	self.timeLast = time.Now()
 
-	// Latencies
+	// Latencies: snapshotted lock-free via the seqlock in self.seq, since
+	// drain is concurrently writing to digests/sinceLastDigests.
+	allTimeLatencies, sinceLastLatencies, sinceLastErrorRate := self.snapshotLatencies()
+	// Ask drain to start a fresh since-last window now that we've read it,
+	// and wait for the reset to actually happen: without waiting, an op
+	// Recorded right after GetStatus returns could land in the still-old
+	// window and then be silently discarded once the reset finally runs.
+	// If drain has already exited (Close, then Finished), there is no one
+	// left to service the request, so fall back to self.finished instead
+	// of blocking forever.
+	ack := make(chan struct{})
+	select {
+	case self.resetRequest <- ack:
+		<-ack
+	case <-self.finished:
+	}
+
 	stats := CombineStats(self.statsCollectors...)
-	allTimeLatencies := make(map[OpType][]int64)
-	sinceLastLatencies := make(map[OpType][]int64)
 	typeOpsSec := make(map[OpType]float64)
 	typeOpsSecLast := make(map[OpType]float64)
+	sloViolations := make(map[OpType]bool)
 
 	for _, opType := range AllOpTypes {
-		// take a snapshot of current status since the latency list keeps
-		// increasing.
-		length := len(self.latencies[opType])
-		snapshot := self.latencies[opType][:length]
-		lastEndPos := self.lastEndPos[opType]
-		self.lastEndPos[opType] = length
-		sinceLastLatencies[opType] =
-			CalculateLatencyStats(snapshot[lastEndPos:])
-		allTimeLatencies[opType] = CalculateLatencyStats(snapshot)
 		self.counts[opType] = stats.Count(opType)
 
 		typeOpsSec[opType] = 0.0
@@ -154,6 +386,11 @@ func (self *StatsAnalyzer) GetStatus() *ExecutionStatus {
 			typeOpsSecLast[opType] = float64(self.counts[opType]-self.countsLast[opType]) * float64(time.Second) / float64(lastDuration)
 		}
 
+		if slo, ok := self.slos[opType]; ok && slo.violated(sinceLastLatencies[opType], sinceLastErrorRate[opType]) {
+			sloViolations[opType] = true
+			self.sloViolationCount++
+			self.sloEverViolated[opType] = true
+		}
 	}
 
 	// have to copy values for countsLast into a new object before returning them
@@ -162,6 +399,13 @@ func (self *StatsAnalyzer) GetStatus() *ExecutionStatus {
 		countsLast[opType] = self.countsLast[opType]
 	}
 
+	// copy sloEverViolated so callers can't mutate the analyzer's own
+	// record of every OpType that has ever violated its SLO
+	sloEverViolated := make(map[OpType]bool, len(self.sloEverViolated))
+	for opType, v := range self.sloEverViolated {
+		sloEverViolated[opType] = v
+	}
+
 	status := ExecutionStatus{
 		OpsExecuted:        *self.opsExecuted,
 		OpsExecutedLast:    self.opsExecutedLast,
@@ -174,6 +418,9 @@ func (self *StatsAnalyzer) GetStatus() *ExecutionStatus {
 		CountsLast:         countsLast,
 		TypeOpsSec:         typeOpsSec,
 		TypeOpsSecLast:     typeOpsSecLast,
+		SLOViolations:      sloViolations,
+		SLOViolationCount:  self.sloViolationCount,
+		SLOEverViolated:    sloEverViolated,
 	}
 
 	// store the latest values in the "last" variables
@@ -185,22 +432,16 @@ func (self *StatsAnalyzer) GetStatus() *ExecutionStatus {
 	return &status
 }
 
-// Sorting facilities
-type int64Slice []int64
-
-func (p int64Slice) Len() int           { return len(p) }
-func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
-func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-
-func CalculateLatencyStats(latencies []int64) []int64 {
-	result := make([]int64, 0, len(latencyPercentiles))
-	length := len(latencies)
-	if length == 0 {
+// CalculateLatencyStats reads off the latencyPercentiles from a t-digest,
+// preserving the []int64-per-percentile shape consumers have always seen
+// from the old sort-based implementation.
+func CalculateLatencyStats(digest *TDigest) []int64 {
+	if digest == nil || digest.Count() == 0 {
 		return emptyLatencies
 	}
-	sort.Sort(int64Slice(latencies))
+	result := make([]int64, 0, len(latencyPercentiles))
 	for _, perc := range latencyPercentiles {
-		result = append(result, latencies[(length-1)*perc/100])
+		result = append(result, int64(digest.Quantile(float64(perc)/100)))
 	}
 	return result
 }
@@ -0,0 +1,46 @@
+package flashback
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BenchmarkRecord measures Record throughput as the number of worker
+// goroutines (and matching shards) grows. Because each worker writes to
+// its own latencyRingBuffer, throughput should keep scaling well past the
+// single mutex-guarded channel the old consumeLatencyChan used, which
+// serialized every worker on one lock.
+func BenchmarkRecord(b *testing.B) {
+	for _, numWorkers := range []int{1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("workers=%d", numWorkers), func(b *testing.B) {
+			opsExecuted := int64(0)
+			analyser := NewStatsAnalyzer(
+				[]*StatsCollector{}, &opsExecuted, numWorkers, 1024, 100, nil,
+			)
+			defer func() {
+				analyser.Close()
+				<-analyser.Finished()
+			}()
+
+			opsPerWorker := b.N / numWorkers
+			if opsPerWorker == 0 {
+				opsPerWorker = 1
+			}
+
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for w := 0; w < numWorkers; w++ {
+				wg.Add(1)
+				go func(workerID int) {
+					defer wg.Done()
+					for i := 0; i < opsPerWorker; i++ {
+						analyser.Record(workerID, AllOpTypes[0], time.Microsecond, false)
+					}
+				}(w)
+			}
+			wg.Wait()
+		})
+	}
+}
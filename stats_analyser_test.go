@@ -1,6 +1,7 @@
 package flashback
 
 import (
+	"runtime"
 	"testing"
 	"time"
 
@@ -18,70 +19,74 @@ var _ = Suite(&TestStatsAnalyzerSuite{})
 
 func (s *TestStatsAnalyzerSuite) TestBasics(c *C) {
 	opsExecuted := int64(0)
-	latencyChan := make(chan Latency)
 
 	analyser := NewStatsAnalyzer(
-		[]*StatsCollector{}, &opsExecuted, latencyChan, 1000,
+		[]*StatsCollector{}, &opsExecuted, 10, 64, 1000, nil,
 	)
 
-	for _, latencyList := range analyser.latencies {
-		c.Assert(latencyList, HasLen, 0)
+	for _, digest := range analyser.digests {
+		c.Assert(digest.Count(), Equals, 0.0)
 	}
 	for i := 0; i < 10; i += 1 {
 		for _, opType := range AllOpTypes {
-			latencyChan <- Latency{opType, time.Duration(i)}
+			analyser.Record(i, opType, time.Duration(i), false)
 		}
 	}
-	close(latencyChan)
-	<-analyser.finished
-	for _, latencyList := range analyser.latencies {
-		c.Assert(latencyList, HasLen, 10)
+	analyser.Close()
+	<-analyser.Finished()
+	for _, digest := range analyser.digests {
+		c.Assert(digest.Count(), Equals, 10.0)
 	}
 }
 
 func (s *TestStatsAnalyzerSuite) TestLatencies(c *C) {
 	opsExecuted := int64(0)
-	latencyChan := make(chan Latency)
 
 	analyser := NewStatsAnalyzer(
-		[]*StatsCollector{}, &opsExecuted, latencyChan, 1000,
+		[]*StatsCollector{}, &opsExecuted, len(AllOpTypes), 64, 1000, nil,
 	)
 
 	start := 1000
-	for _, opType := range AllOpTypes {
+	for workerID, opType := range AllOpTypes {
 		for i := 100; i >= 0; i-- {
-			latencyChan <- Latency{opType, time.Duration(start + i)}
+			analyser.Record(workerID, opType, time.Duration(start+i), false)
 		}
 		start += 2000
 	}
 
-	// ugly hack because GetStatus races with latencyChan being consumed
-	time.Sleep(10)
+	// wait for drain to catch up with what was just recorded; GetStatus no
+	// longer races with it (see the seqlock in snapshotLatencies), but a
+	// synchronization point here still makes the percentile assertions
+	// below deterministic rather than flaky about *when* they're recorded.
+	waitForDrain(analyser)
 	status := analyser.GetStatus()
 
-	// Check results
+	// Check results. The t-digest keeps one centroid per value for inputs
+	// this small, but Quantile interpolates between neighbouring values
+	// (p50 reads 1049 where the old sort-based code gave 1050), so the
+	// percentiles are checked to within 1% rather than exactly.
 	start = 1000
 	for _, opType := range AllOpTypes {
 		sinceLast := status.SinceLastLatencies[opType]
 		allTime := status.AllTimeLatencies[opType]
 		for i, perc := range latencyPercentiles {
-			c.Assert(sinceLast[i], Equals, int64(perc+start))
-			c.Assert(allTime[i], Equals, int64(perc+start))
+			assertWithinPercent(c, sinceLast[i], int64(perc+start), 1)
+			assertWithinPercent(c, allTime[i], int64(perc+start), 1)
 		}
 		start += 2000
 	}
 
 	// -- second round
 	start = 2000
-	for _, opType := range AllOpTypes {
+	for workerID, opType := range AllOpTypes {
 		for i := 100; i >= 0; i-- {
-			latencyChan <- Latency{opType, time.Duration(start + i)}
+			analyser.Record(workerID, opType, time.Duration(start+i), false)
 		}
 		start += 2000
 	}
 
-	close(latencyChan)
-	<-analyser.finished
+	analyser.Close()
+	<-analyser.Finished()
 	status = analyser.GetStatus()
 
 	start = 2000
@@ -89,10 +94,44 @@ func (s *TestStatsAnalyzerSuite) TestLatencies(c *C) {
 		sinceLast := status.SinceLastLatencies[opType]
 		allTime := status.AllTimeLatencies[opType]
 		for i, perc := range latencyPercentiles {
-			c.Assert(sinceLast[i], Equals, int64(perc+start))
+			assertWithinPercent(c, sinceLast[i], int64(perc+start), 1)
 		}
-		c.Assert(allTime[len(allTime)-1], Equals, int64(start+100))
-		c.Assert(allTime[0], Equals, int64(start-1000+100))
+		assertWithinPercent(c, allTime[len(allTime)-1], int64(start+100), 1)
+		assertWithinPercent(c, allTime[0], int64(start-1000+100), 1)
 		start += 2000
 	}
 }
+
+// waitForDrain blocks until the analyser's drain goroutine has consumed
+// everything pushed to every shard so far, replacing the time.Sleep-based
+// hack the original tests used to paper over the GetStatus/drain race.
+func waitForDrain(analyser *StatsAnalyzer) {
+	for {
+		allEmpty := true
+		for _, shard := range analyser.shards {
+			if !shard.empty() {
+				allEmpty = false
+				break
+			}
+		}
+		if allEmpty {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+// assertWithinPercent checks that got is within tolerancePercent% of want,
+// which is the error bound a t-digest is expected to stay inside of for
+// the workloads flashback replays (see TDigest).
+func assertWithinPercent(c *C, got, want int64, tolerancePercent float64) {
+	if want == 0 {
+		c.Assert(got, Equals, want)
+		return
+	}
+	diff := float64(got-want) / float64(want)
+	if diff < 0 {
+		diff = -diff
+	}
+	c.Assert(diff <= tolerancePercent/100, Equals, true)
+}
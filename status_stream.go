@@ -0,0 +1,60 @@
+package flashback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// StreamStatus writes one NDJSON-encoded ExecutionStatus record to w every
+// interval, so downstream tooling can tail the file for the duration of a
+// replay. It blocks until Close has been called and drain has consumed
+// everything already recorded, so callers typically run it in its own
+// goroutine. Once the final record has been written it prints a pass/fail
+// SLO summary to standard output; if writing a record fails, it returns
+// that error without printing the summary.
+func (s *StatsAnalyzer) StreamStatus(w io.Writer, interval time.Duration) error {
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := enc.Encode(s.GetStatus()); err != nil {
+				return err
+			}
+		case <-s.finished:
+			status := s.GetStatus()
+			if err := enc.Encode(status); err != nil {
+				return err
+			}
+			printSLOSummary(status)
+			return nil
+		}
+	}
+}
+
+// printSLOSummary prints a single pass/fail line to standard output
+// summarizing whether the replay met every configured SLO, so flashback
+// can be used as a regression gate in CI. It reports every OpType that
+// violated its SLO at any point during the run, not just in the final
+// window, since a replay that regressed briefly in the middle and
+// recovered by the end should still fail the gate.
+func printSLOSummary(status *ExecutionStatus) {
+	if status.SLOViolationCount == 0 {
+		fmt.Println("flashback: all SLOs met")
+		return
+	}
+
+	var violated []string
+	for opType, v := range status.SLOEverViolated {
+		if v {
+			violated = append(violated, fmt.Sprint(opType))
+		}
+	}
+	sort.Strings(violated)
+	fmt.Printf("flashback: SLO violations (%d total) in op type(s): %v\n", status.SLOViolationCount, violated)
+}
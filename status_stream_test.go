@@ -0,0 +1,112 @@
+package flashback
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStreamStatusAndSLOViolations(t *testing.T) {
+	opsExecuted := int64(0)
+
+	slos := map[OpType]SLO{
+		AllOpTypes[0]: {MaxP99Latency: 1 * time.Nanosecond},
+	}
+	analyser := NewStatsAnalyzer(
+		[]*StatsCollector{}, &opsExecuted, len(AllOpTypes), 64, 1000, slos,
+	)
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- analyser.StreamStatus(&buf, time.Hour)
+	}()
+
+	for workerID, opType := range AllOpTypes {
+		analyser.Record(workerID, opType, 100*time.Millisecond, false)
+	}
+	analyser.Close()
+	<-analyser.Finished()
+
+	if err := <-done; err != nil {
+		t.Fatalf("StreamStatus returned error: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	var status ExecutionStatus
+	if err := dec.Decode(&status); err != nil {
+		t.Fatalf("decoding NDJSON record: %v", err)
+	}
+	if !status.SLOViolations[AllOpTypes[0]] {
+		t.Errorf("expected SLO violation for %v, got none", AllOpTypes[0])
+	}
+	if status.SLOViolationCount == 0 {
+		t.Errorf("expected non-zero SLOViolationCount")
+	}
+}
+
+func TestErrorRateSLOViolation(t *testing.T) {
+	opsExecuted := int64(0)
+
+	slos := map[OpType]SLO{
+		AllOpTypes[0]: {MaxErrorRate: 0.1},
+	}
+	analyser := NewStatsAnalyzer(
+		[]*StatsCollector{}, &opsExecuted, len(AllOpTypes), 64, 1000, slos,
+	)
+
+	// 2 out of 4 ops errored: a 50% error rate, comfortably over the 10%
+	// MaxErrorRate above, while the latency itself stays well under any
+	// reasonable p99 bound.
+	analyser.Record(0, AllOpTypes[0], time.Microsecond, false)
+	analyser.Record(0, AllOpTypes[0], time.Microsecond, true)
+	analyser.Record(0, AllOpTypes[0], time.Microsecond, false)
+	analyser.Record(0, AllOpTypes[0], time.Microsecond, true)
+	waitForDrain(analyser)
+
+	status := analyser.GetStatus()
+	if !status.SLOViolations[AllOpTypes[0]] {
+		t.Errorf("expected error-rate SLO violation for %v, got none", AllOpTypes[0])
+	}
+
+	analyser.Close()
+	<-analyser.Finished()
+}
+
+func TestSLOEverViolatedSurvivesRecovery(t *testing.T) {
+	opsExecuted := int64(0)
+
+	slos := map[OpType]SLO{
+		AllOpTypes[0]: {MaxP99Latency: 1 * time.Nanosecond},
+	}
+	analyser := NewStatsAnalyzer(
+		[]*StatsCollector{}, &opsExecuted, len(AllOpTypes), 64, 1000, slos,
+	)
+
+	// First window violates the p99 SLO.
+	analyser.Record(0, AllOpTypes[0], 100*time.Millisecond, false)
+	waitForDrain(analyser)
+	status := analyser.GetStatus()
+	if !status.SLOViolations[AllOpTypes[0]] {
+		t.Fatalf("expected SLO violation in first window")
+	}
+	if !status.SLOEverViolated[AllOpTypes[0]] {
+		t.Errorf("expected SLOEverViolated set after first window's violation")
+	}
+
+	// Second window recovers; SLOViolations should clear but
+	// SLOEverViolated must still report the earlier violation.
+	analyser.Record(0, AllOpTypes[0], time.Nanosecond, false)
+	waitForDrain(analyser)
+	status = analyser.GetStatus()
+	if status.SLOViolations[AllOpTypes[0]] {
+		t.Errorf("expected no SLO violation in recovered window")
+	}
+	if !status.SLOEverViolated[AllOpTypes[0]] {
+		t.Errorf("expected SLOEverViolated to still report the earlier violation")
+	}
+
+	analyser.Close()
+	<-analyser.Finished()
+}
@@ -0,0 +1,199 @@
+package flashback
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// defaultCompression controls the trade-off between accuracy and the number
+// of centroids a TDigest retains. Higher values produce more accurate
+// quantile estimates at the cost of more centroids; 100 keeps percentile
+// error under ~1% for the latency distributions flashback deals with.
+const defaultCompression = 100
+
+// centroid is a single cluster of the digest: the mean of the values it
+// represents and how many values have been folded into it.
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest is a self-contained implementation of Ted Dunning's t-digest
+// sketch (https://github.com/tdunning/t-digest). It gives bounded-memory,
+// streaming estimates of arbitrary percentiles: inserts are O(centroids)
+// and the centroid count stays proportional to the compression parameter
+// regardless of how many values have been observed.
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	count       float64
+}
+
+// NewTDigest returns an empty digest with the given compression parameter.
+// A compression <= 0 falls back to defaultCompression.
+func NewTDigest(compression float64) *TDigest {
+	if compression <= 0 {
+		compression = defaultCompression
+	}
+	return &TDigest{compression: compression}
+}
+
+// Count returns the total weight (number of inserted values) in the digest.
+func (t *TDigest) Count() float64 {
+	return t.count
+}
+
+// Insert adds a single observation of weight 1 to the digest.
+func (t *TDigest) Insert(x float64) {
+	t.InsertWeighted(x, 1)
+}
+
+// InsertWeighted adds an observation with an explicit weight, merging it
+// into the nearest centroid that has room under the size bound, or else
+// creating a new centroid for it.
+func (t *TDigest) InsertWeighted(x, weight float64) {
+	if len(t.centroids) == 0 {
+		t.centroids = append(t.centroids, centroid{mean: x, weight: weight})
+		t.count += weight
+		return
+	}
+
+	i := sort.Search(len(t.centroids), func(i int) bool {
+		return t.centroids[i].mean >= x
+	})
+
+	candidates := make([]int, 0, 2)
+	if i < len(t.centroids) {
+		candidates = append(candidates, i)
+	}
+	if i > 0 {
+		candidates = append(candidates, i-1)
+	}
+
+	cumulative := t.cumulativeWeight(candidates)
+
+	best := -1
+	bestDist := math.Inf(1)
+	for _, ci := range candidates {
+		c := t.centroids[ci]
+		q := (cumulative[ci] + c.weight/2) / t.count
+		bound := t.sizeBound(q)
+		if c.weight+weight > bound {
+			continue
+		}
+		dist := math.Abs(c.mean - x)
+		if dist < bestDist {
+			bestDist = dist
+			best = ci
+		}
+	}
+
+	if best == -1 {
+		c := centroid{mean: x, weight: weight}
+		t.centroids = append(t.centroids, centroid{})
+		copy(t.centroids[i+1:], t.centroids[i:])
+		t.centroids[i] = c
+	} else {
+		c := &t.centroids[best]
+		c.mean += (x - c.mean) * weight / (c.weight + weight)
+		c.weight += weight
+	}
+
+	t.count += weight
+
+	if len(t.centroids) > int(20*t.compression) {
+		t.compress()
+	}
+}
+
+// cumulativeWeight returns, for each requested centroid index, the total
+// weight of every centroid preceding it.
+func (t *TDigest) cumulativeWeight(indexes []int) map[int]float64 {
+	result := make(map[int]float64, len(indexes))
+	want := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		want[i] = true
+	}
+	running := 0.0
+	for i, c := range t.centroids {
+		if want[i] {
+			result[i] = running
+		}
+		running += c.weight
+	}
+	return result
+}
+
+// sizeBound implements k(q) = 4*N*q*(1-q)/delta, the maximum weight a
+// centroid at quantile q is allowed to accumulate before a new centroid
+// must be created instead. Dividing by delta (compression) is what keeps
+// the centroid count bounded by roughly delta regardless of N; getting
+// this backwards (multiplying by delta) makes the bound so large that
+// every insert merges into one centroid, collapsing the whole digest.
+func (t *TDigest) sizeBound(q float64) float64 {
+	return 4 * t.count * q * (1 - q) / t.compression
+}
+
+// compress rebuilds the digest by reinserting its centroids, as weighted
+// points, in random order. Random order avoids the bias that would come
+// from replaying centroids in sorted order, and tends to reduce the total
+// centroid count back toward the compression bound.
+func (t *TDigest) compress() {
+	old := t.centroids
+	rand.Shuffle(len(old), func(i, j int) { old[i], old[j] = old[j], old[i] })
+
+	fresh := &TDigest{compression: t.compression}
+	for _, c := range old {
+		fresh.InsertWeighted(c.mean, c.weight)
+	}
+	t.centroids = fresh.centroids
+	t.count = fresh.count
+}
+
+// Merge folds another digest's centroids into t, as weighted points.
+func (t *TDigest) Merge(other *TDigest) {
+	if other == nil {
+		return
+	}
+	centroids := make([]centroid, len(other.centroids))
+	copy(centroids, other.centroids)
+	rand.Shuffle(len(centroids), func(i, j int) { centroids[i], centroids[j] = centroids[j], centroids[i] })
+	for _, c := range centroids {
+		t.InsertWeighted(c.mean, c.weight)
+	}
+}
+
+// Quantile returns an estimate of the value at quantile q (0 <= q <= 1) by
+// walking centroids in order, accumulating weight until the target rank is
+// reached, and interpolating between the two surrounding means.
+func (t *TDigest) Quantile(q float64) float64 {
+	if len(t.centroids) == 0 {
+		return 0
+	}
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+
+	rank := q * t.count
+	running := 0.0
+	for i, c := range t.centroids {
+		next := running + c.weight
+		if rank <= next || i == len(t.centroids)-1 {
+			if i == 0 {
+				return c.mean
+			}
+			prev := t.centroids[i-1]
+			// interpolate linearly between the previous and current
+			// centroid means based on where rank falls between them.
+			span := next - running
+			if span == 0 {
+				return c.mean
+			}
+			frac := (rank - running) / span
+			return prev.mean + frac*(c.mean-prev.mean)
+		}
+		running = next
+	}
+	return t.centroids[len(t.centroids)-1].mean
+}
@@ -0,0 +1,85 @@
+package flashback
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// TestTDigestAccuracy checks that percentile estimates from a TDigest stay
+// within ~1% of the exact value computed by sorting the same dataset, for
+// a workload shaped like the latencies flashback records during a replay.
+func TestTDigestAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = rng.ExpFloat64() * 1000
+	}
+
+	digest := NewTDigest(100)
+	for _, v := range values {
+		digest.Insert(v)
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	for _, perc := range latencyPercentiles {
+		q := float64(perc) / 100
+		exact := sorted[int(q*float64(len(sorted)-1))]
+		got := digest.Quantile(q)
+
+		if exact == 0 {
+			continue
+		}
+		diff := (got - exact) / exact
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > 0.01 {
+			t.Errorf("p%d: got %.2f, exact %.2f, error %.4f%% exceeds 1%%", perc, got, exact, diff*100)
+		}
+	}
+}
+
+// TestTDigestMerge checks that merging two digests produces percentile
+// estimates within 2% of the exact percentiles of both datasets combined,
+// computed by sorting them.
+func TestTDigestMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+
+	a := NewTDigest(100)
+	b := NewTDigest(100)
+	var all []float64
+	for i := 0; i < 5000; i++ {
+		v := rng.ExpFloat64() * 1000
+		a.Insert(v)
+		all = append(all, v)
+	}
+	for i := 0; i < 5000; i++ {
+		v := rng.ExpFloat64() * 1000
+		b.Insert(v)
+		all = append(all, v)
+	}
+
+	a.Merge(b)
+
+	sorted := append([]float64(nil), all...)
+	sort.Float64s(sorted)
+
+	for _, perc := range latencyPercentiles {
+		q := float64(perc) / 100
+		exact := sorted[int(q*float64(len(sorted)-1))]
+		got := a.Quantile(q)
+		if exact == 0 {
+			continue
+		}
+		diff := (got - exact) / exact
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > 0.02 {
+			t.Errorf("merged p%d: got %.2f, exact %.2f, error %.4f%% exceeds 2%%", perc, got, exact, diff*100)
+		}
+	}
+}